@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func sign(secret, method, requestURI, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + requestURI + "\n"))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHmacAuthMiddleware(t *testing.T) {
+	const secret = "shared-secret"
+	a := &hmacAuth{secret: []byte(secret)}
+	ok := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	newRequest := func(requestURI, body, signature string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, requestURI, strings.NewReader(body))
+		req.Header.Set("X-Signature", signature)
+		return req
+	}
+
+	t.Run("valid signature over method, path, query and body is accepted", func(t *testing.T) {
+		req := newRequest("/signal/on_phone?state=true", "", sign(secret, http.MethodPost, "/signal/on_phone?state=true", ""))
+		rec := httptest.NewRecorder()
+		ok.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+	})
+
+	t.Run("signature for one query does not authenticate a different query", func(t *testing.T) {
+		signature := sign(secret, http.MethodPost, "/signal/on_phone?state=true", "")
+		req := newRequest("/signal/on_phone?state=false", "", signature)
+		rec := httptest.NewRecorder()
+		ok.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected a signature scoped to one query string to be rejected for another, got %d", rec.Code)
+		}
+	})
+
+	t.Run("signature for one path does not authenticate a different path", func(t *testing.T) {
+		signature := sign(secret, http.MethodPost, "/signal/on_phone?state=true", "")
+		req := newRequest("/signal/on_laptop?state=true", "", signature)
+		rec := httptest.NewRecorder()
+		ok.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected a signature scoped to one path to be rejected for another, got %d", rec.Code)
+		}
+	})
+
+	t.Run("wrong secret is rejected", func(t *testing.T) {
+		req := newRequest("/signal/on_phone?state=true", "", sign("wrong-secret", http.MethodPost, "/signal/on_phone?state=true", ""))
+		rec := httptest.NewRecorder()
+		ok.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", rec.Code)
+		}
+	})
+
+	t.Run("missing signature is rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/signal/on_phone?state=true", nil)
+		rec := httptest.NewRecorder()
+		ok.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// EntryID identifies a running time entry within a specific backend.
+type EntryID string
+
+// StartEntryOptions carries the per-entry overrides a rule can specify on
+// top of a backend's configured defaults.
+type StartEntryOptions struct {
+	// ProjectID overrides the backend's configured project when non-empty.
+	ProjectID string
+	// Billable overrides the backend's default billable flag when non-nil.
+	Billable *bool
+}
+
+// TimeTrackerBackend is implemented by every time-tracking provider this
+// tool can report to. Multiple backends can be active at once; an entry
+// is mirrored to each of them independently. ctx carries the request's
+// correlation ids so a backend can forward them to its API.
+type TimeTrackerBackend interface {
+	StartEntry(ctx context.Context, desc string, tags []string, opts StartEntryOptions) (EntryID, error)
+	StopEntry(ctx context.Context, id EntryID) error
+	ListTags(ctx context.Context) (map[string]string, error)
+}
+
+// initBackends parses a comma-separated backend spec (e.g. "clockify,toggl")
+// and constructs the corresponding TimeTrackerBackend implementations.
+func initBackends(spec string) []TimeTrackerBackend {
+	var backends []TimeTrackerBackend
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(name) {
+		case "clockify":
+			backends = append(backends, newClockifyBackend(clockify_key, clockify_workspace, clockify_project))
+		case "toggl":
+			backends = append(backends, newTogglBackend(toggl_key, toggl_workspace, toggl_project))
+		default:
+			if name != "" {
+				logger.Warn("unknown backend", "name", name)
+			}
+		}
+	}
+	return backends
+}
+
+// startEntry starts a new time entry on every configured backend that
+// doesn't already have one running, in parallel, and remembers each
+// resulting EntryID so it can be stopped later. A backend with an entry
+// already recorded in activeEntryIDs (from an earlier, partially-successful
+// attempt at the same event) is skipped, so retrying a requeued start event
+// after a partial failure can't start a second, orphaned entry on a backend
+// that already succeeded. It returns the first error encountered, if any,
+// so the caller can decide whether the event needs to be queued for retry.
+func startEntry(ctx context.Context, desc string, tags []string, opts StartEntryOptions) error {
+	if len(activeEntryIDs) != len(backends) {
+		activeEntryIDs = make([]EntryID, len(backends))
+	}
+	errs := make([]error, len(backends))
+
+	var wg sync.WaitGroup
+	for i, b := range backends {
+		if activeEntryIDs[i] != "" {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, b TimeTrackerBackend) {
+			defer wg.Done()
+			id, err := b.StartEntry(ctx, desc, tags, opts)
+			if err != nil {
+				errs[i] = fmt.Errorf("backend %d: %w", i, err)
+				return
+			}
+			activeEntryIDs[i] = id
+		}(i, b)
+	}
+	wg.Wait()
+
+	return firstError(errs)
+}
+
+// stopEntry stops the previously started entry on every backend in
+// parallel, clearing activeEntryIDs for each backend it successfully stops.
+// A backend whose stop call fails keeps its recorded EntryID so a retry of
+// the requeued stop event only re-stops the backends that actually failed.
+func stopEntry(ctx context.Context) error {
+	errs := make([]error, len(backends))
+
+	var wg sync.WaitGroup
+	for i, b := range backends {
+		if i >= len(activeEntryIDs) || activeEntryIDs[i] == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, b TimeTrackerBackend, id EntryID) {
+			defer wg.Done()
+			if err := b.StopEntry(ctx, id); err != nil {
+				errs[i] = fmt.Errorf("backend %d: %w", i, err)
+				return
+			}
+			activeEntryIDs[i] = ""
+		}(i, b, activeEntryIDs[i])
+	}
+	wg.Wait()
+
+	return firstError(errs)
+}
+
+// restoreActiveEntryIDs seeds the in-memory activeEntryIDs from a queued
+// stop event's persisted snapshot, but only when activeEntryIDs hasn't been
+// initialized yet for the current backend list - i.e. right after a
+// restart, before any startEntry/stopEntry call in this process has had a
+// chance to size it. It's a no-op once activeEntryIDs is sized (the
+// snapshot may be stale by then; the live array is authoritative) or when
+// the snapshot doesn't match the current backend count, e.g. the backend
+// list changed since the event was queued.
+func restoreActiveEntryIDs(snapshot []EntryID) {
+	if len(activeEntryIDs) == len(backends) || len(snapshot) != len(backends) {
+		return
+	}
+	activeEntryIDs = append([]EntryID(nil), snapshot...)
+}
+
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeBackend is a minimal TimeTrackerBackend for exercising startEntry's
+// per-backend retry behavior without hitting a real API.
+type fakeBackend struct {
+	startErr   error
+	startCalls int
+	stoppedID  EntryID
+}
+
+func (b *fakeBackend) StartEntry(ctx context.Context, desc string, tags []string, opts StartEntryOptions) (EntryID, error) {
+	b.startCalls++
+	if b.startErr != nil {
+		return "", b.startErr
+	}
+	return "entry-ok", nil
+}
+
+func (b *fakeBackend) StopEntry(ctx context.Context, id EntryID) error {
+	b.stoppedID = id
+	return nil
+}
+
+func (b *fakeBackend) ListTags(ctx context.Context) (map[string]string, error) {
+	return nil, nil
+}
+
+func TestStartEntryRetriesOnlyFailedBackends(t *testing.T) {
+	orig := backends
+	origIDs := activeEntryIDs
+	defer func() { backends, activeEntryIDs = orig, origIDs }()
+
+	ok := &fakeBackend{}
+	failing := &fakeBackend{startErr: errors.New("boom")}
+	backends = []TimeTrackerBackend{ok, failing}
+	activeEntryIDs = nil
+
+	if err := startEntry(context.Background(), "desc", nil, StartEntryOptions{}); err == nil {
+		t.Fatal("expected an error from the failing backend")
+	}
+	if ok.startCalls != 1 {
+		t.Fatalf("expected the succeeding backend to be called once, got %d", ok.startCalls)
+	}
+	if failing.startCalls != 1 {
+		t.Fatalf("expected the failing backend to be called once, got %d", failing.startCalls)
+	}
+
+	failing.startErr = nil
+	if err := startEntry(context.Background(), "desc", nil, StartEntryOptions{}); err != nil {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+	if ok.startCalls != 1 {
+		t.Fatalf("expected the already-succeeded backend not to be retried, got %d calls", ok.startCalls)
+	}
+	if failing.startCalls != 2 {
+		t.Fatalf("expected the previously-failing backend to be retried, got %d calls", failing.startCalls)
+	}
+}
+
+func TestStopEntryClearsOnlyStoppedBackends(t *testing.T) {
+	orig := backends
+	origIDs := activeEntryIDs
+	defer func() { backends, activeEntryIDs = orig, origIDs }()
+
+	a := &fakeBackend{}
+	b := &fakeBackend{}
+	backends = []TimeTrackerBackend{a, b}
+	activeEntryIDs = []EntryID{"entry-a", "entry-b"}
+
+	if err := stopEntry(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if activeEntryIDs[0] != "" || activeEntryIDs[1] != "" {
+		t.Fatalf("expected both entries cleared, got %v", activeEntryIDs)
+	}
+}
+
+func TestRestoreActiveEntryIDsSeedsAfterRestart(t *testing.T) {
+	orig := backends
+	origIDs := activeEntryIDs
+	defer func() { backends, activeEntryIDs = orig, origIDs }()
+
+	backends = []TimeTrackerBackend{&fakeBackend{}, &fakeBackend{}}
+	activeEntryIDs = nil // as if the process just restarted
+
+	restoreActiveEntryIDs([]EntryID{"entry-a", "entry-b"})
+
+	if len(activeEntryIDs) != 2 || activeEntryIDs[0] != "entry-a" || activeEntryIDs[1] != "entry-b" {
+		t.Fatalf("expected activeEntryIDs restored from snapshot, got %v", activeEntryIDs)
+	}
+}
+
+func TestRestoreActiveEntryIDsDoesNotOverwriteLiveState(t *testing.T) {
+	orig := backends
+	origIDs := activeEntryIDs
+	defer func() { backends, activeEntryIDs = orig, origIDs }()
+
+	backends = []TimeTrackerBackend{&fakeBackend{}, &fakeBackend{}}
+	activeEntryIDs = []EntryID{"", "entry-b"} // already sized - no restart happened
+
+	restoreActiveEntryIDs([]EntryID{"entry-a", "entry-b"})
+
+	if activeEntryIDs[0] != "" || activeEntryIDs[1] != "entry-b" {
+		t.Fatalf("expected already-sized activeEntryIDs left untouched, got %v", activeEntryIDs)
+	}
+}
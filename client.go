@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	retryInitialBackoff = 200 * time.Millisecond
+	retryMaxBackoff     = 30 * time.Second
+	retryMaxAttempts    = 5
+)
+
+// clockifyClient wraps a reusable http.Client tuned for talking to
+// time-tracker APIs: pooled keep-alive connections plus an exponential
+// backoff retry loop, so a blip or a 2-second timeout on Clockify's side no
+// longer takes the whole server down with it.
+type clockifyClient struct {
+	http *http.Client
+}
+
+func newClockifyClient() *clockifyClient {
+	return &clockifyClient{
+		http: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				MaxIdleConnsPerHost: 10,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+	}
+}
+
+// Do performs an HTTP request, retrying on 5xx, 429 (honoring Retry-After),
+// and transient network errors with jittered exponential backoff. It
+// returns an error instead of crashing the process so a single flaky
+// request can no longer take down the server.
+func (c *clockifyClient) Do(ctx context.Context, method, url, authHeader, authValue, reqBody string) ([]byte, error) {
+	start := time.Now()
+	body, err := c.do(ctx, method, url, authHeader, authValue, reqBody)
+
+	backendCallDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		backendCallErrorsTotal.WithLabelValues(method).Inc()
+	}
+	return body, err
+}
+
+func (c *clockifyClient) do(ctx context.Context, method, url, authHeader, authValue, reqBody string) ([]byte, error) {
+	backoff := retryInitialBackoff
+	var lastErr error
+
+	for attempt := 1; attempt <= retryMaxAttempts; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBufferString(reqBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(authHeader, authValue)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "auto-timetracker")
+		for header, value := range correlationHeaders(ctx) {
+			req.Header.Set(header, value)
+		}
+
+		res, err := c.http.Do(req)
+		if err != nil {
+			lastErr = err
+		} else {
+			body, readErr := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+
+			switch {
+			case readErr != nil:
+				lastErr = readErr
+			case res.StatusCode == http.StatusTooManyRequests:
+				lastErr = fmt.Errorf("%s %s: %d", method, url, res.StatusCode)
+				if wait, ok := retryAfter(res.Header.Get("Retry-After")); ok {
+					if sleepErr := sleepOrDone(ctx, wait); sleepErr != nil {
+						return nil, sleepErr
+					}
+					continue
+				}
+			case res.StatusCode >= 500:
+				lastErr = fmt.Errorf("%s %s: %d", method, url, res.StatusCode)
+			case res.StatusCode >= 400:
+				return nil, fmt.Errorf("%s %s: %d: %s", method, url, res.StatusCode, string(body))
+			default:
+				return body, nil
+			}
+		}
+
+		if attempt == retryMaxAttempts {
+			break
+		}
+
+		sleep := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2+1)))
+		if sleepErr := sleepOrDone(ctx, sleep); sleepErr != nil {
+			return nil, sleepErr
+		}
+		backoff *= 2
+		if backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+	}
+
+	return nil, fmt.Errorf("giving up after %d attempts: %w", retryMaxAttempts, lastErr)
+}
+
+// sleepOrDone waits for either d to elapse or ctx to be canceled/expired,
+// returning ctx.Err() in the latter case so a canceled context aborts a
+// pending retry backoff instead of blocking for the full sleep.
+func sleepOrDone(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func retryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	if when, err := http.ParseTime(header); err == nil {
+		return time.Until(when), true
+	}
+	return 0, false
+}
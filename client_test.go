@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	cases := []struct {
+		name   string
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{name: "empty", header: "", ok: false},
+		{name: "seconds", header: "5", want: 5 * time.Second, ok: true},
+		{name: "invalid", header: "not-a-value", ok: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := retryAfter(c.header)
+			if ok != c.ok {
+				t.Fatalf("retryAfter(%q) ok = %v, want %v", c.header, ok, c.ok)
+			}
+			if ok && got != c.want {
+				t.Fatalf("retryAfter(%q) = %v, want %v", c.header, got, c.want)
+			}
+		})
+	}
+}
+
+func TestClockifyClientDoRetriesOn5xx(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	c := newClockifyClient()
+	body, err := c.Do(context.Background(), "GET", server.URL, "x-api-key", "secret", "")
+	if err != nil {
+		t.Fatalf("Do() returned error: %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+	if string(body) != `{"ok":true}` {
+		t.Fatalf("unexpected body: %s", body)
+	}
+}
+
+func TestClockifyClientDoReturnsImmediatelyOn4xx(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	c := newClockifyClient()
+	if _, err := c.Do(context.Background(), "GET", server.URL, "x-api-key", "secret", ""); err == nil {
+		t.Fatal("expected an error for a 4xx response")
+	}
+	if attempts != 1 {
+		t.Fatalf("expected no retries on 4xx, got %d attempts", attempts)
+	}
+}
+
+func TestClockifyClientDoAbortsRetryBackoffOnContextCancel(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := newClockifyClient()
+
+	start := time.Now()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := c.Do(ctx, "GET", server.URL, "x-api-key", "secret", ""); err == nil {
+		t.Fatal("expected an error once the context was canceled")
+	}
+	if elapsed := time.Since(start); elapsed >= retryMaxBackoff {
+		t.Fatalf("expected cancellation to cut the backoff short, took %v", elapsed)
+	}
+	if attempts == 0 || attempts >= retryMaxAttempts {
+		t.Fatalf("expected cancellation mid-backoff, not after exhausting retries, got %d attempts", attempts)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// clockifyBackend reports time entries to Clockify. It is the original
+// backend this tool was built around.
+type clockifyBackend struct {
+	apiKey     string
+	workspace  string
+	project    string
+	tags       map[string]string
+	lastUserID string
+}
+
+func newClockifyBackend(apiKey, workspace, project string) *clockifyBackend {
+	b := &clockifyBackend{apiKey: apiKey, workspace: workspace, project: project}
+
+	tags, err := b.ListTags(context.Background())
+	if err != nil {
+		logger.Warn("clockify: failed to list tags", "error", err)
+	}
+	b.tags = tags
+
+	return b
+}
+
+func (b *clockifyBackend) StartEntry(ctx context.Context, desc string, tags []string, opts StartEntryOptions) (EntryID, error) {
+	tagString := ""
+	for _, tag := range tags {
+		if id, ok := b.tags[tag]; ok {
+			if tagString != "" {
+				tagString += ","
+			}
+			tagString += `"` + id + `"`
+		}
+	}
+
+	project := b.project
+	if opts.ProjectID != "" {
+		project = opts.ProjectID
+	}
+	billable := true
+	if opts.Billable != nil {
+		billable = *opts.Billable
+	}
+
+	var jsonStr = `{
+		"start": "` + time.Now().UTC().Format("2006-01-02T15:04:05.000Z") + `",
+		"billable": "` + strconv.FormatBool(billable) + `",
+		"description": "` + desc + `",
+		"projectId": "` + project + `",
+		"tagIds": [` + tagString + `]
+	  }`
+
+	var response TimeEntryDto
+	if err := requestWithHeader(ctx, "POST", "https://api.clockify.me/api/v1/workspaces/"+b.workspace+"/time-entries", &response, jsonStr, "x-api-key", b.apiKey); err != nil {
+		return "", err
+	}
+
+	b.lastUserID = response.UserId
+
+	return EntryID(response.Id), nil
+}
+
+// StopEntry closes the currently running entry. Clockify's API doesn't take
+// the entry id to stop, it always closes whatever is running for the user,
+// so id is only used to guard against stopping a backend we never started.
+func (b *clockifyBackend) StopEntry(ctx context.Context, id EntryID) error {
+	var jsonStr = `{"end": "` + time.Now().UTC().Format("2006-01-02T15:04:05.000Z") + `"}`
+
+	var body interface{}
+	return requestWithHeader(ctx, "PATCH", "https://api.clockify.me/api/v1/workspaces/"+b.workspace+"/user/"+b.lastUserID+"/time-entries", &body, jsonStr, "x-api-key", b.apiKey)
+}
+
+func (b *clockifyBackend) ListTags(ctx context.Context) (map[string]string, error) {
+	var tags []Tags
+	if err := requestWithHeader(ctx, "GET", "https://api.clockify.me/api/v1/workspaces/"+b.workspace+"/tags", &tags, "", "x-api-key", b.apiKey); err != nil {
+		return nil, err
+	}
+
+	tagMap := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		tagMap[tag.Name] = tag.Id
+	}
+	return tagMap, nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// engine is the running state machine: it tracks the current value of
+// every named signal, matches them against the loaded RuleSet, and turns
+// the winning rule into start/stop calls against the configured backends.
+// It replaces the old fixed WorkingState{at_work, on_laptop, on_phone}
+// struct and its hardcoded truth table.
+type engine struct {
+	mu            sync.Mutex // guards rulesPath, ruleSet, knownSignals, signals, debounceTimer
+	rulesPath     string
+	ruleSet       *RuleSet
+	knownSignals  map[string]bool
+	signals       map[string]bool
+	debounceTimer *time.Timer
+
+	// applyMu serializes a whole evaluate() call - rule match through the
+	// backend start/stop call through the hasEntry/lastEvent/lastEntryStart
+	// update below - so two signal changes arriving back to back can never
+	// both decide to start an entry and race on the package-level
+	// backends/activeEntryIDs state in backend.go.
+	applyMu        sync.Mutex
+	hasEntry       bool
+	lastEvent      queuedEvent
+	lastEntryStart time.Time
+}
+
+func newEngine(rulesPath string) (*engine, error) {
+	e := &engine{rulesPath: rulesPath, signals: make(map[string]bool)}
+	if err := e.reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// reload re-reads the rules file, letting an operator tweak it without
+// restarting the server (see the SIGHUP handler in main).
+func (e *engine) reload() error {
+	rs, err := loadRuleSet(e.rulesPath)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.ruleSet = rs
+	e.knownSignals = rs.signalNames()
+	e.mu.Unlock()
+	return nil
+}
+
+// setSignal records a named signal's new value and, once the configured
+// debounce window has passed with no further change, re-evaluates the
+// rules against the current signal set.
+func (e *engine) setSignal(ctx context.Context, name string, value bool) {
+	e.mu.Lock()
+	e.signals[name] = value
+	recordSignal(name, value, e.knownSignals)
+	debounce := e.ruleSet.Debounce
+
+	if debounce <= 0 {
+		e.mu.Unlock()
+		e.evaluate(ctx)
+		return
+	}
+
+	if e.debounceTimer != nil {
+		e.debounceTimer.Stop()
+	}
+	e.debounceTimer = time.AfterFunc(debounce, func() { e.evaluate(context.Background()) })
+	e.mu.Unlock()
+}
+
+// evaluate matches the current signals against the rules and, if the
+// resulting action differs from what's currently running, applies it -
+// unless MinEntryDuration says the running entry hasn't lasted long enough
+// yet, in which case evaluation is rescheduled for when it has. This is
+// what stops a 2-second phone call from creating (and instantly replacing)
+// a Clockify entry.
+func (e *engine) evaluate(ctx context.Context) {
+	e.applyMu.Lock()
+	defer e.applyMu.Unlock()
+
+	e.mu.Lock()
+	signals := make(map[string]bool, len(e.signals))
+	for k, v := range e.signals {
+		signals[k] = v
+	}
+	rs := e.ruleSet
+	e.mu.Unlock()
+
+	hasEntry := e.hasEntry
+	sinceStart := time.Since(e.lastEntryStart)
+
+	rule := rs.match(signals)
+	if rule == nil {
+		return
+	}
+	event := ruleToEvent(rule)
+
+	if hasEntry && rs.MinEntryDuration > sinceStart && !eventsEqual(event, e.lastEvent) {
+		time.AfterFunc(rs.MinEntryDuration-sinceStart, func() { e.evaluate(context.Background()) })
+		return
+	}
+	if hasEntry && eventsEqual(event, e.lastEvent) {
+		return
+	}
+
+	log := loggerFromContext(ctx)
+	event.RequestID, event.UserID, event.Traceparent = correlationFromContext(ctx)
+
+	if err := applyEvent(ctx, event); err != nil {
+		log.Error("backend call failed, queuing for retry", "error", err)
+		if event.Kind == "stop" {
+			event.EntryIDs = append([]EntryID(nil), activeEntryIDs...)
+		}
+		if qerr := retryQueue.enqueue(event); qerr != nil {
+			log.Error("failed to persist retry queue", "error", qerr)
+		}
+	}
+
+	e.lastEvent = event
+	e.hasEntry = event.Kind == "start"
+	e.lastEntryStart = time.Now()
+}
+
+// drainQueue retries events persisted in q, serialized against live signal
+// evaluation via the same applyMu that guards evaluate() - otherwise a
+// background retry tick and a concurrent /signal/... request could both
+// reach applyEvent/startEntry/stopEntry at once and race on the
+// package-level backends/activeEntryIDs state in backend.go.
+func (e *engine) drainQueue(q *eventQueue) {
+	q.drain(func(ev queuedEvent) error {
+		e.applyMu.Lock()
+		defer e.applyMu.Unlock()
+		return applyEvent(contextFromEvent(ev), ev)
+	})
+}
+
+// ruleToEvent maps a matched rule to the clock-in/out event it implies.
+func ruleToEvent(rule *Rule) queuedEvent {
+	if rule.Stop {
+		return queuedEvent{Kind: "stop"}
+	}
+	return queuedEvent{
+		Kind:      "start",
+		Desc:      rule.Action.Description,
+		Tags:      rule.Action.Tags,
+		ProjectID: rule.Action.ProjectID,
+		Billable:  rule.Action.Billable,
+	}
+}
+
+// eventsEqual reports whether two events would produce the same backend
+// call, used to avoid re-starting an already-running entry.
+func eventsEqual(a, b queuedEvent) bool {
+	if a.Kind != b.Kind || a.Desc != b.Desc || a.ProjectID != b.ProjectID {
+		return false
+	}
+	if (a.Billable == nil) != (b.Billable == nil) || (a.Billable != nil && *a.Billable != *b.Billable) {
+		return false
+	}
+	if len(a.Tags) != len(b.Tags) {
+		return false
+	}
+	for i := range a.Tags {
+		if a.Tags[i] != b.Tags[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// applyEvent runs a queued event against every backend, used both for the
+// initial attempt and for retries drained from the on-disk queue. ctx
+// carries the correlation ids to forward to the backend call; for retries
+// drained after a restart it's rebuilt from the ids persisted on e.
+func applyEvent(ctx context.Context, e queuedEvent) error {
+	switch e.Kind {
+	case "start":
+		err := startEntry(ctx, e.Desc, e.Tags, StartEntryOptions{ProjectID: e.ProjectID, Billable: e.Billable})
+		for _, tag := range e.Tags {
+			clockEventsTotal.WithLabelValues("start", e.Desc, tag).Inc()
+		}
+		return err
+	case "stop":
+		restoreActiveEntryIDs(e.EntryIDs)
+		err := stopEntry(ctx)
+		clockEventsTotal.WithLabelValues("stop", "", "").Inc()
+		return err
+	}
+	return nil
+}
+
+// correlationFromContext reads back the ids tracing stashed on ctx so they
+// can be persisted alongside a queued event for later retries.
+func correlationFromContext(ctx context.Context) (requestID, userID, traceparent string) {
+	requestID, _ = ctx.Value(requestIDKey).(string)
+	userID, _ = ctx.Value(userIDKey).(string)
+	traceparent, _ = ctx.Value(traceParentKey).(string)
+	return
+}
+
+// contextFromEvent rebuilds a context carrying a queued event's persisted
+// correlation ids, so a retry drained after a restart still forwards them.
+func contextFromEvent(e queuedEvent) context.Context {
+	ctx := context.Background()
+	if e.RequestID != "" {
+		ctx = context.WithValue(ctx, requestIDKey, e.RequestID)
+	}
+	if e.UserID != "" {
+		ctx = context.WithValue(ctx, userIDKey, e.UserID)
+	}
+	if e.Traceparent != "" {
+		ctx = context.WithValue(ctx, traceParentKey, e.Traceparent)
+	}
+	return ctx
+}
+
+// signalHandler handles POST /signal/{name}?state=true|false, the generic
+// entry point for arbitrary presence signals. It supersedes the fixed
+// on_phone/on_laptop/at_work routes, which are now aliases for it.
+func signalHandler(e *engine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/signal/")
+		if name == "" || strings.Contains(name, "/") {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		value, err := checkParamTrue("state", r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		loggerFromContext(r.Context()).Debug("signal", "name", name, "state", value)
+		e.setSignal(r.Context(), name, value)
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "Succeeded")
+	})
+}
+
+// aliasSignal exposes one fixed signal name under a legacy route
+// (/on_phone, /on_laptop, /at_work), forwarding to the same engine as
+// /signal/{name}.
+func aliasSignal(e *engine, name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value, err := checkParamTrue("state", r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		loggerFromContext(r.Context()).Debug(name, "state", value)
+		e.setSignal(r.Context(), name, value)
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "Succeeded")
+	})
+}
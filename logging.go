@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ctxKey namespaces the correlation ids tracing stashes on each request's
+// context so they don't collide with other packages' context keys.
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	userIDKey
+	traceParentKey
+)
+
+// newLogger builds the process-wide structured logger. Every line is a JSON
+// object on stdout; -log-level/LOG_LEVEL controls verbosity.
+func newLogger(levelName string) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: parseLogLevel(levelName)}))
+}
+
+func parseLogLevel(levelName string) slog.Level {
+	switch strings.ToLower(levelName) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// fatalf logs a structured error line and exits, replacing the
+// log.Fatalf calls the old *log.Logger made available.
+func fatalf(format string, args ...interface{}) {
+	logger.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// tracing stamps each request with a request id (reusing an incoming
+// X-Request-Id if present), and propagates X-User-Id and the W3C
+// traceparent header through the context so both our own logs and the
+// Clockify/Toggl calls an entry triggers can be correlated back to it.
+func tracing(nextRequestID func() string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get("X-Request-Id")
+			if requestID == "" {
+				requestID = nextRequestID()
+			}
+			ctx := context.WithValue(r.Context(), requestIDKey, requestID)
+
+			if userID := r.Header.Get("X-User-Id"); userID != "" {
+				ctx = context.WithValue(ctx, userIDKey, userID)
+			}
+			if traceparent := r.Header.Get("Traceparent"); traceparent != "" {
+				ctx = context.WithValue(ctx, traceParentKey, traceparent)
+			}
+
+			w.Header().Set("X-Request-Id", requestID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// logging emits one structured access-log line per request, tagged with
+// whatever correlation ids tracing found.
+func logging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		loggerFromContext(r.Context()).Info("http_request",
+			"method", r.Method,
+			"url", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
+
+// loggerFromContext returns the process logger enriched with whatever
+// correlation ids tracing attached to ctx.
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	l := logger
+	if v, ok := ctx.Value(requestIDKey).(string); ok {
+		l = l.With("request_id", v)
+	}
+	if v, ok := ctx.Value(userIDKey).(string); ok {
+		l = l.With("user_id", v)
+	}
+	if v, ok := ctx.Value(traceParentKey).(string); ok {
+		l = l.With("traceparent", v)
+	}
+	return l
+}
+
+// correlationHeaders extracts the ids tracing stashed on ctx so outbound
+// Clockify/Toggl calls carry them too, closing the loop from webhook to
+// time entry.
+func correlationHeaders(ctx context.Context) map[string]string {
+	headers := make(map[string]string, 3)
+	if v, ok := ctx.Value(requestIDKey).(string); ok {
+		headers["X-Request-Id"] = v
+	}
+	if v, ok := ctx.Value(userIDKey).(string); ok {
+		headers["X-User-Id"] = v
+	}
+	if v, ok := ctx.Value(traceParentKey).(string); ok {
+		headers["Traceparent"] = v
+	}
+	return headers
+}
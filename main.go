@@ -1,29 +1,22 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync/atomic"
+	"syscall"
 	"time"
 )
 
-type key int
-
-type WorkingState struct {
-	at_work   bool
-	on_laptop bool
-	on_phone  bool
-}
-
 type Tags struct {
 	Id   string
 	Name string
@@ -34,54 +27,95 @@ type TimeEntryDto struct {
 	UserId string
 }
 
-const (
-	requestIDKey key = 0
-)
-
 var (
 	listenAddr         string
 	healthy            int32
 	clockify_key       string
 	clockify_workspace string
 	clockify_project   string
-	state              WorkingState
-	lastTimeEntryId    string
-	lastUserId         string
-	tagMap             map[string]string
-	logger             *log.Logger
+	toggl_key          string
+	toggl_workspace    string
+	toggl_project      string
+	backendSpec        string
+	authMethodName     string
+	authParam          string
+	queuePath          string
+	rulesPath          string
+	metricsEnabled     bool
+	pprofEnabled       bool
+	adminListenAddr    string
+	backends           []TimeTrackerBackend
+	activeEntryIDs     []EntryID
+	httpClient         *clockifyClient
+	retryQueue         *eventQueue
+	logLevel           string
+	logger             *slog.Logger
 )
 
 func main() {
 
-	logger = log.New(os.Stdout, "http: ", log.LstdFlags)
-	logger.Println("Server is starting...")
 	port := os.Getenv("PORT")
-	logger.Println(port)
 
 	flag.StringVar(&listenAddr, "listen-addr", ":"+port, "server listen address")
+	flag.StringVar(&backendSpec, "backend", envOrDefault("BACKEND", "clockify"), "comma-separated list of time-tracking backends to mirror entries to (clockify, toggl)")
+	flag.StringVar(&authMethodName, "auth", envOrDefault("AUTH_METHOD", "query"), "auth method to protect the router with (bearer, basic, hmac, query)")
+	flag.StringVar(&authParam, "auth-param", envOrDefault("AUTH_PARAM", os.Getenv("AUTH_KEY")), "parameter for the chosen auth method (token, user:pass, or shared secret)")
+	flag.StringVar(&queuePath, "queue-path", envOrDefault("QUEUE_PATH", "timetracker-queue.json"), "path to the on-disk retry queue for undelivered clock-in/out events")
+	flag.StringVar(&rulesPath, "rules", envOrDefault("RULES_PATH", ""), "path to a YAML/JSON rules file mapping signal combinations to actions (default: built-in at_work/on_laptop/on_phone table)")
+	flag.BoolVar(&metricsEnabled, "metrics", envBoolOrDefault("METRICS", false), "mount a Prometheus /metrics endpoint on the public router")
+	flag.BoolVar(&pprofEnabled, "pprof", envBoolOrDefault("PPROF", false), "mount net/http/pprof on a separate, unauthenticated admin listener")
+	flag.StringVar(&adminListenAddr, "admin-listen-addr", envOrDefault("ADMIN_LISTEN_ADDR", "localhost:6060"), "listen address for the pprof admin server")
+	flag.StringVar(&logLevel, "log-level", envOrDefault("LOG_LEVEL", "info"), "log verbosity (debug, info, warn, error)")
 	flag.Parse()
 
+	logger = newLogger(logLevel)
+	logger.Info("Server is starting...", "port", port)
+
+	newAuthMethod, ok := AvailableMethods[authMethodName]
+	if !ok {
+		fatalf("unknown auth method %q", authMethodName)
+	}
+	authMethod := newAuthMethod()
+	if err := authMethod.ParseParam(authParam); err != nil {
+		fatalf("invalid -auth-param for %q: %v", authMethodName, err)
+	}
+	logger.Info("auth method configured", "method", authMethodName, "usage", authMethod.Usage())
+
 	// Get ENV Variables
-	key := os.Getenv("AUTH_KEY")
 	clockify_key = os.Getenv("CLOCKIFY_KEY")
 	clockify_workspace = os.Getenv("CLOCKIFY_WORKSPACE")
 	clockify_project = os.Getenv("CLOCKIFY_PROJECT")
+	toggl_key = os.Getenv("TOGGL_KEY")
+	toggl_workspace = os.Getenv("TOGGL_WORKSPACE")
+	toggl_project = os.Getenv("TOGGL_PROJECT")
 
-	tagMap = getTags()
+	httpClient = newClockifyClient()
+	retryQueue = newEventQueue(queuePath)
 
-	// Init State
-	state = WorkingState{
-		at_work:   false,
-		on_laptop: false,
-		on_phone:  false,
+	backends = initBackends(backendSpec)
+
+	eng, err := newEngine(rulesPath)
+	if err != nil {
+		fatalf("loading rules: %v", err)
+	}
+	if rulesPath != "" {
+		logger.Info("rules loaded", "path", rulesPath)
 	}
 
+	go drainQueuePeriodically(eng)
+
 	router := http.NewServeMux()
 	router.Handle("/", index())
 	router.Handle("/health", health())
-	router.Handle("/on_phone", on_phone(&state))
-	router.Handle("/on_laptop", on_laptop(&state))
-	router.Handle("/at_work", at_work(&state))
+	router.Handle("/signal/", signalHandler(eng))
+	router.Handle("/on_phone", aliasSignal(eng, "on_phone"))
+	router.Handle("/on_laptop", aliasSignal(eng, "on_laptop"))
+	router.Handle("/at_work", aliasSignal(eng, "at_work"))
+	mountMetrics(router, metricsEnabled)
+
+	if pprofEnabled {
+		go servePprof(adminListenAddr)
+	}
 
 	nextRequestID := func() string {
 		return fmt.Sprintf("%d", time.Now().UnixNano())
@@ -89,20 +123,31 @@ func main() {
 
 	server := &http.Server{
 		Addr:         listenAddr,
-		Handler:      tracing(nextRequestID)(logging(logger)(auth(key)(router))),
-		ErrorLog:     logger,
+		Handler:      tracing(nextRequestID)(metricsMiddleware(logging(authMethod.Middleware(router)))),
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  15 * time.Second,
 	}
 
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			logger.Info("SIGHUP received, reloading rules", "path", rulesPath)
+			if err := eng.reload(); err != nil {
+				logger.Error("failed to reload rules, keeping previous rule set", "error", err)
+			}
+		}
+	}()
+
 	done := make(chan bool)
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 
 	go func() {
 		<-quit
-		logger.Println("Server is shutting down...")
+		logger.Info("Server is shutting down...")
 		atomic.StoreInt32(&healthy, 0)
 
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -110,19 +155,32 @@ func main() {
 
 		server.SetKeepAlivesEnabled(false)
 		if err := server.Shutdown(ctx); err != nil {
-			logger.Fatalf("Could not gracefully shutdown the server: %v\n", err)
+			fatalf("could not gracefully shutdown the server: %v", err)
 		}
 		close(done)
 	}()
 
-	logger.Println("Server is ready to handle requests at", listenAddr)
+	logger.Info("Server is ready to handle requests", "addr", listenAddr)
 	atomic.StoreInt32(&healthy, 1)
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		logger.Fatalf("Could not listen on %s: %v\n", listenAddr, err)
+		fatalf("could not listen on %s: %v", listenAddr, err)
 	}
 
 	<-done
-	logger.Println("Server stopped")
+	logger.Info("Server stopped")
+}
+
+// drainQueuePeriodically retries undelivered clock-in/out events in the
+// background so a restart (or a blip that exhausted the client's own
+// retries) doesn't lose them for good. The retry is routed through eng's
+// applyMu so it can never race a live /signal/... request into
+// startEntry/stopEntry at the same time.
+func drainQueuePeriodically(eng *engine) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		eng.drainQueue(retryQueue)
+	}
 }
 
 func index() http.Handler {
@@ -140,147 +198,26 @@ func index() http.Handler {
 
 func health() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if atomic.LoadInt32(&healthy) == 1 {
-			w.WriteHeader(http.StatusNoContent)
+		if atomic.LoadInt32(&healthy) != 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
 			return
 		}
-		w.WriteHeader(http.StatusServiceUnavailable)
-	})
-}
-
-func logging(logger *log.Logger) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			defer func() {
-				requestID, ok := r.Context().Value(requestIDKey).(string)
-				if !ok {
-					requestID = "unknown"
-				}
-				logger.Println(requestID, r.Method, r.URL.Path, r.RemoteAddr, r.UserAgent())
-			}()
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-func tracing(nextRequestID func() string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			requestID := r.Header.Get("X-Request-Id")
-			if requestID == "" {
-				requestID = nextRequestID()
-			}
-			ctx := context.WithValue(r.Context(), requestIDKey, requestID)
-			w.Header().Set("X-Request-Id", requestID)
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
-	}
-}
-
-func auth(key string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			keys, ok := r.URL.Query()["auth"]
 
-			if !ok && len(keys) < 1 || keys[0] != key {
-				http.Error(w, "Unauthorized.", 401)
-				return
-			}
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-func at_work(state *WorkingState) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		stateParam, e := checkParamTrue("state", r)
-
-		if e != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
+		status := "ok"
+		queueDepth := retryQueue.depth()
+		if queueDepth > 0 {
+			status = "degraded"
 		}
-		logger.Println(stateParam)
-		state.at_work = stateParam
-
-		evaluateState(state)
 
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		fmt.Fprintln(w, "Succeeded")
-	})
-}
-
-func on_laptop(state *WorkingState) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		stateParam, e := checkParamTrue("state", r)
-
-		if e != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-
-		logger.Println(stateParam)
-		state.on_laptop = stateParam
-
-		evaluateState(state)
-
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintln(w, "Succeeded")
-	})
-}
-
-func on_phone(state *WorkingState) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		stateParam, e := checkParamTrue("state", r)
-
-		if e != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		logger.Println(stateParam)
-		state.on_phone = stateParam
-
-		evaluateState(state)
-
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintln(w, "Succeeded")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":      status,
+			"queue_depth": queueDepth,
+		})
 	})
 }
 
-func evaluateState(state *WorkingState) {
-	logger.Println(*state)
-	// type WorkingState struct {at_work, on_laptop, on_phone}
-	switch *state {
-	case WorkingState{false, false, false}:
-		// I am not working so
-		clock_out()
-
-	case WorkingState{true, false, false}:
-		// I am at work
-		clock_in("Normal Work", "@Work")
-
-	case WorkingState{true, true, false}:
-		// I am at work, working on my PC
-		clock_in("Normal Work", "@PC")
-
-	case WorkingState{true, true, true}:
-		// I am at work, working on my PC, taking a call
-		clock_in("Normal Work", "@Phone")
-
-	case WorkingState{false, true, false}:
-		// I am NOT at work, working on my PC
-		clock_in("Remote Work", "@PC")
-
-	case WorkingState{false, true, true}:
-		// I am NOT at work, working on my PC, taking a call
-		clock_in("Remote Work", "@Phone")
-
-	case WorkingState{false, false, true}:
-		// I am NOT at work, NOT ony my PC, taking a call
-		clock_in("Remote Work/Call", "@Phone")
-	}
-
-}
-
 func getParamVal(param string, r *http.Request) (string, error) {
 	keys, ok := r.URL.Query()[param]
 
@@ -295,86 +232,39 @@ func checkParamTrue(param string, r *http.Request) (bool, error) {
 	return param == "true", err
 }
 
-func clock_in(message string, tag string) {
-	logger.Println("Clock in")
-	url := "https://api.clockify.me/api/v1/workspaces/" + clockify_workspace + "/time-entries"
-
-	tagString := ""
-
-	if len(tag) > 0 {
-		tagString = `"` + tagMap[tag] + `"`
-	}
-
-	var jsonStr = `{
-		"start": "` + time.Now().UTC().Format("2006-01-02T15:04:05.000Z") + `",
-		"billable": "true",
-		"description": "` + message + `",
-		"projectId": "` + clockify_project + `",
-		"tagIds": [` + tagString + `]
-	  }`
-
-	var response TimeEntryDto
-	request("POST", url, &response, jsonStr)
-
-	logger.Println(string(jsonStr))
-
-	lastTimeEntryId = response.Id
-	lastUserId = response.UserId
-}
-
-func clock_out() {
-	logger.Println("Clock out")
-	var jsonStr = `{"end": "` + time.Now().UTC().Format("2006-01-02T15:04:05.000Z") + `"}`
-	logger.Println(string(jsonStr))
-
-	url := "https://api.clockify.me/api/v1/workspaces/" + clockify_workspace + "/user/" + lastUserId + "/time-entries"
-	var body interface{}
-	request("PATCH", url, &body, jsonStr)
-
-	logger.Println("response Body:", body)
-
+// basicAuthHeader builds the "Basic ..." value for an HTTP Authorization
+// header from a username/password pair.
+func basicAuthHeader(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
 }
 
-func getTags() map[string]string {
-	var tags []Tags
-	request("GET", "https://api.clockify.me/api/v1/workspaces/"+clockify_workspace+"/tags", &tags, "")
-
-	tagMap := make(map[string]string, 15)
-	logger.Println("Available Tags:")
-	for _, tag := range tags {
-		logger.Println(" - " + tag.Name)
-		tagMap[tag.Name] = tag.Id
+func envOrDefault(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
 	}
-	return tagMap
+	return def
 }
 
-func request(method string, url string, resp interface{}, reqBody string) {
-	client := http.Client{
-		Timeout: time.Second * 2,
-	}
-
-	req, err := http.NewRequest(method, url, bytes.NewBuffer([]byte(reqBody)))
-	req.Header.Set("x-api-key", clockify_key)
-	req.Header.Set("Content-Type", "application/json")
-
+func envBoolOrDefault(name string, def bool) bool {
+	v, err := strconv.ParseBool(os.Getenv(name))
 	if err != nil {
-		log.Fatal(err)
-	}
-
-	req.Header.Set("User-Agent", "auto-timetracker")
-
-	res, getErr := client.Do(req)
-	if getErr != nil {
-		log.Fatal(getErr)
+		return def
 	}
+	return v
+}
 
-	body, readErr := ioutil.ReadAll(res.Body)
-	if readErr != nil {
-		log.Fatal(readErr)
+// requestWithHeader performs an API call through the shared retrying
+// client with a caller-supplied auth header, so each backend can
+// authenticate its own way while sharing connection pooling and backoff.
+// Unlike the original helper it returns an error instead of crashing the
+// server on failure.
+func requestWithHeader(ctx context.Context, method string, url string, resp interface{}, reqBody string, authHeader string, authValue string) error {
+	body, err := httpClient.Do(ctx, method, url, authHeader, authValue, reqBody)
+	if err != nil {
+		return err
 	}
-
-	jsonErr := json.Unmarshal(body, &resp)
-	if jsonErr != nil {
-		log.Fatal(jsonErr)
+	if resp == nil {
+		return nil
 	}
+	return json.Unmarshal(body, resp)
 }
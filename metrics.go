@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "timetracker_http_requests_total",
+		Help: "Total HTTP requests handled, by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "timetracker_http_request_duration_seconds",
+		Help:    "HTTP request latency, by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route"})
+
+	workingStateGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "timetracker_working_state",
+		Help: "Current value (0/1) of each presence signal.",
+	}, []string{"signal"})
+
+	clockEventsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "timetracker_clock_events_total",
+		Help: "Total clock_in/clock_out events, by description and tag.",
+	}, []string{"kind", "description", "tag"})
+
+	backendCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "timetracker_backend_call_duration_seconds",
+		Help:    "Latency of calls to time-tracker backend APIs, by HTTP method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+
+	backendCallErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "timetracker_backend_call_errors_total",
+		Help: "Total failed calls to time-tracker backend APIs, by HTTP method.",
+	}, []string{"method"})
+
+	queueDepthGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "timetracker_queue_depth",
+		Help: "Number of clock_in/clock_out events waiting to be retried.",
+	})
+)
+
+// mountMetrics registers the Prometheus handler on router when enabled via
+// -metrics/METRICS.
+func mountMetrics(router *http.ServeMux, enabled bool) {
+	if !enabled {
+		return
+	}
+	router.Handle("/metrics", promhttp.Handler())
+}
+
+// servePprof mounts net/http/pprof on its own listener, separate from the
+// auth-protected public router, when enabled via -pprof/PPROF.
+func servePprof(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	logger.Info("pprof listening", "addr", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.Warn("pprof server stopped", "error", err)
+	}
+}
+
+// statusRecorder captures the status code written by downstream handlers so
+// metricsMiddleware can label it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// knownRoutes are the fixed, non-parameterized routes mounted on the public
+// router. Anything else falls back to routeTemplate's wildcard/other
+// buckets so metrics labels stay bounded.
+var knownRoutes = map[string]bool{
+	"/":          true,
+	"/health":    true,
+	"/on_phone":  true,
+	"/on_laptop": true,
+	"/at_work":   true,
+	"/metrics":   true,
+}
+
+// routeTemplate collapses a request path to a fixed, low-cardinality label.
+// /signal/{name} takes its name from the caller, and this middleware runs
+// before authMethod.Middleware, so labeling by the raw path would let any
+// caller - even an unauthenticated one - mint unbounded distinct
+// Prometheus time series just by hitting varied /signal/<name> paths.
+func routeTemplate(path string) string {
+	if knownRoutes[path] {
+		return path
+	}
+	if strings.HasPrefix(path, "/signal/") {
+		return "/signal/{name}"
+	}
+	return "other"
+}
+
+// metricsMiddleware records request counts and latency histograms per route.
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		route := routeTemplate(r.URL.Path)
+		httpRequestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		httpRequestDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// signalLabel bounds a signal's metrics label the same way routeTemplate
+// bounds the route label: any name not referenced by the loaded rules
+// collapses into "other", so a caller of /signal/{name} can't mint
+// unbounded Prometheus time series just by varying the name.
+func signalLabel(name string, known map[string]bool) string {
+	if !known[name] {
+		return "other"
+	}
+	return name
+}
+
+// recordSignal reports a single named signal's current value, replacing the
+// old fixed at_work/on_laptop/on_phone trio now that signals are arbitrary.
+func recordSignal(name string, value bool, known map[string]bool) {
+	workingStateGauge.WithLabelValues(signalLabel(name, known)).Set(boolToFloat(value))
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestRouteTemplate(t *testing.T) {
+	cases := []struct {
+		path string
+		want string
+	}{
+		{"/", "/"},
+		{"/health", "/health"},
+		{"/on_phone", "/on_phone"},
+		{"/metrics", "/metrics"},
+		{"/signal/on_laptop", "/signal/{name}"},
+		{"/signal/anything-a-caller-makes-up", "/signal/{name}"},
+		{"/does-not-exist", "other"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			if got := routeTemplate(c.path); got != c.want {
+				t.Fatalf("routeTemplate(%q) = %q, want %q", c.path, got, c.want)
+			}
+		})
+	}
+}
+
+func TestSignalLabel(t *testing.T) {
+	known := map[string]bool{"at_work": true, "on_laptop": true, "on_phone": true}
+
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"at_work", "at_work"},
+		{"on_phone", "on_phone"},
+		{"anything-a-caller-makes-up", "other"},
+		{"", "other"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := signalLabel(c.name, known); got != c.want {
+				t.Fatalf("signalLabel(%q) = %q, want %q", c.name, got, c.want)
+			}
+		})
+	}
+}
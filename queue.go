@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// queuedEvent is a clock-in/clock-out event that couldn't be delivered to
+// every backend and needs to be retried after a restart.
+type queuedEvent struct {
+	Kind      string   `json:"kind"` // "start" or "stop"
+	Desc      string   `json:"desc,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	ProjectID string   `json:"project_id,omitempty"`
+	Billable  *bool    `json:"billable,omitempty"`
+
+	// Correlation ids captured at enqueue time, so a retry drained after a
+	// restart still forwards them to the backend call.
+	RequestID   string `json:"request_id,omitempty"`
+	UserID      string `json:"user_id,omitempty"`
+	Traceparent string `json:"traceparent,omitempty"`
+
+	// EntryIDs snapshots the in-memory activeEntryIDs at the moment a
+	// "stop" event is queued, one id per configured backend. activeEntryIDs
+	// is purely in-memory, so without this a stop event drained after a
+	// restart would have no way to know which entry to close on each
+	// backend; see restoreActiveEntryIDs in backend.go.
+	EntryIDs []EntryID `json:"entry_ids,omitempty"`
+}
+
+// eventQueue persists undelivered events to a JSON file so a server restart
+// doesn't silently drop a clock-in/out that Clockify never saw.
+type eventQueue struct {
+	mu   sync.Mutex
+	path string
+}
+
+func newEventQueue(path string) *eventQueue {
+	return &eventQueue{path: path}
+}
+
+func (q *eventQueue) load() ([]queuedEvent, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.loadLocked()
+}
+
+func (q *eventQueue) loadLocked() ([]queuedEvent, error) {
+	data, err := ioutil.ReadFile(q.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var events []queuedEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (q *eventQueue) saveLocked(events []queuedEvent) error {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(q.path, data, 0600); err != nil {
+		return err
+	}
+	queueDepthGauge.Set(float64(len(events)))
+	return nil
+}
+
+// enqueue appends an event to the on-disk queue.
+func (q *eventQueue) enqueue(e queuedEvent) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	events, err := q.loadLocked()
+	if err != nil {
+		logger.Warn("queue: failed to load existing queue, starting fresh", "error", err)
+	}
+	events = append(events, e)
+	return q.saveLocked(events)
+}
+
+// drain attempts to re-apply every queued event with process, keeping (in
+// order) only the ones that fail again. q.mu is deliberately NOT held across
+// process: process (engine.drainQueue's callback) takes engine.applyMu, and
+// a live /signal/... request takes applyMu first and then, on failure,
+// q.mu via enqueue - holding both locks in opposite order here would
+// deadlock the two goroutines against each other once at least two events
+// are queued. Instead, drain snapshots the queue, processes it lock-free,
+// then re-reads the on-disk queue before persisting so a concurrent
+// enqueue's write (which can only append, never appears before our
+// snapshot) is folded into the result instead of silently overwritten.
+func (q *eventQueue) drain(process func(queuedEvent) error) {
+	q.mu.Lock()
+	events, err := q.loadLocked()
+	q.mu.Unlock()
+	if err != nil || len(events) == 0 {
+		return
+	}
+
+	var remaining []queuedEvent
+	for _, e := range events {
+		if err := process(e); err != nil {
+			logger.Warn("queue: retry failed, keeping event for later", "error", err)
+			remaining = append(remaining, e)
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	current, err := q.loadLocked()
+	if err != nil {
+		logger.Error("queue: failed to reload queue before persisting drain result", "error", err)
+		return
+	}
+
+	var appended []queuedEvent
+	if len(current) > len(events) {
+		appended = current[len(events):]
+	}
+	final := append(remaining, appended...)
+
+	if err := q.saveLocked(final); err != nil {
+		logger.Error("queue: failed to persist after drain", "error", err)
+	}
+}
+
+// depth reports how many events are currently waiting to be retried, used
+// to report a degraded /health status.
+func (q *eventQueue) depth() int {
+	events, err := q.load()
+	if err != nil {
+		return 0
+	}
+	return len(events)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func init() {
+	if logger == nil {
+		logger = newLogger("error")
+	}
+}
+
+func TestEventQueueDrainKeepsFailedEvents(t *testing.T) {
+	q := newEventQueue(filepath.Join(t.TempDir(), "queue.json"))
+
+	if err := q.enqueue(queuedEvent{Kind: "start", Desc: "a"}); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if err := q.enqueue(queuedEvent{Kind: "start", Desc: "b"}); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	var processed []string
+	q.drain(func(e queuedEvent) error {
+		processed = append(processed, e.Desc)
+		if e.Desc == "a" {
+			return errFakeDrain
+		}
+		return nil
+	})
+
+	if len(processed) != 2 || processed[0] != "a" || processed[1] != "b" {
+		t.Fatalf("expected both events processed in order, got %v", processed)
+	}
+
+	remaining, err := q.load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(remaining) != 1 || remaining[0].Desc != "a" {
+		t.Fatalf("expected only the failed event kept, got %v", remaining)
+	}
+}
+
+// TestEventQueueDrainPreservesConcurrentEnqueue exercises the lock-free
+// process window in drain: an enqueue that lands while process is running
+// (without q.mu held, so a live evaluate() can still reach enqueue) must not
+// be dropped when drain persists its own result afterwards.
+func TestEventQueueDrainPreservesConcurrentEnqueue(t *testing.T) {
+	q := newEventQueue(filepath.Join(t.TempDir(), "queue.json"))
+
+	if err := q.enqueue(queuedEvent{Kind: "stop"}); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	q.drain(func(e queuedEvent) error {
+		if err := q.enqueue(queuedEvent{Kind: "start", Desc: "concurrent"}); err != nil {
+			t.Fatalf("concurrent enqueue: %v", err)
+		}
+		return errFakeDrain
+	})
+
+	remaining, err := q.load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(remaining) != 2 || remaining[0].Kind != "stop" || remaining[1].Desc != "concurrent" {
+		t.Fatalf("expected the failed event and the concurrent enqueue both kept, got %v", remaining)
+	}
+}
+
+type fakeDrainError string
+
+func (e fakeDrainError) Error() string { return string(e) }
+
+const errFakeDrain = fakeDrainError("boom")
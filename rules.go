@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RuleAction describes what a matching rule does: start (or, via Stop,
+// close) a time entry.
+type RuleAction struct {
+	Description string   `yaml:"description" json:"description"`
+	Tags        []string `yaml:"tags" json:"tags"`
+	ProjectID   string   `yaml:"project_id,omitempty" json:"project_id,omitempty"`
+	Billable    *bool    `yaml:"billable,omitempty" json:"billable,omitempty"`
+}
+
+// Rule maps a combination of boolean signals to an action. When multiple
+// rules match the current signals, the one with the highest Priority wins;
+// ties break on declaration order. A signal value of "*" in When matches
+// regardless of the signal's current state, so rules can be as specific or
+// as general as needed.
+type Rule struct {
+	Priority int               `yaml:"priority" json:"priority"`
+	When     map[string]string `yaml:"when" json:"when"`
+	Stop     bool              `yaml:"stop" json:"stop"`
+	Action   RuleAction        `yaml:"action" json:"action"`
+}
+
+// RuleSet is the loaded, ready-to-evaluate rules config.
+type RuleSet struct {
+	// Debounce coalesces rapid signal flaps: evaluation only runs once no
+	// signal has changed for this long.
+	Debounce time.Duration
+	// MinEntryDuration delays switching away from a just-started entry
+	// until it has run for at least this long, so a 2-second phone call
+	// doesn't create (and immediately replace) a Clockify entry.
+	MinEntryDuration time.Duration
+	Rules            []Rule
+}
+
+type ruleSetFile struct {
+	Debounce         string `yaml:"debounce" json:"debounce"`
+	MinEntryDuration string `yaml:"min_entry_duration" json:"min_entry_duration"`
+	Rules            []Rule `yaml:"rules" json:"rules"`
+}
+
+// loadRuleSet reads a rules file (YAML or JSON, chosen by extension). An
+// empty path falls back to defaultRuleSet, which reproduces this tool's
+// original hardcoded at_work/on_laptop/on_phone truth table.
+func loadRuleSet(path string) (*RuleSet, error) {
+	if path == "" {
+		return defaultRuleSet(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading rules file: %w", err)
+	}
+
+	var file ruleSetFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &file)
+	default:
+		err = yaml.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing rules file: %w", err)
+	}
+
+	rs := &RuleSet{Rules: file.Rules}
+
+	if file.Debounce != "" {
+		if rs.Debounce, err = time.ParseDuration(file.Debounce); err != nil {
+			return nil, fmt.Errorf("parsing debounce: %w", err)
+		}
+	}
+	if file.MinEntryDuration != "" {
+		if rs.MinEntryDuration, err = time.ParseDuration(file.MinEntryDuration); err != nil {
+			return nil, fmt.Errorf("parsing min_entry_duration: %w", err)
+		}
+	}
+
+	sort.SliceStable(rs.Rules, func(i, j int) bool {
+		return rs.Rules[i].Priority > rs.Rules[j].Priority
+	})
+
+	return rs, nil
+}
+
+// defaultRuleSet reproduces the original hardcoded 3-signal truth table, so
+// a deployment without -rules behaves exactly as before.
+func defaultRuleSet() *RuleSet {
+	return &RuleSet{
+		Rules: []Rule{
+			{When: map[string]string{"at_work": "false", "on_laptop": "false", "on_phone": "false"}, Stop: true},
+			{When: map[string]string{"at_work": "true", "on_laptop": "false", "on_phone": "false"},
+				Action: RuleAction{Description: "Normal Work", Tags: []string{"@Work"}}},
+			{When: map[string]string{"at_work": "true", "on_laptop": "true", "on_phone": "false"},
+				Action: RuleAction{Description: "Normal Work", Tags: []string{"@PC"}}},
+			{When: map[string]string{"at_work": "true", "on_laptop": "true", "on_phone": "true"},
+				Action: RuleAction{Description: "Normal Work", Tags: []string{"@Phone"}}},
+			{When: map[string]string{"at_work": "false", "on_laptop": "true", "on_phone": "false"},
+				Action: RuleAction{Description: "Remote Work", Tags: []string{"@PC"}}},
+			{When: map[string]string{"at_work": "false", "on_laptop": "true", "on_phone": "true"},
+				Action: RuleAction{Description: "Remote Work", Tags: []string{"@Phone"}}},
+			{When: map[string]string{"at_work": "false", "on_laptop": "false", "on_phone": "true"},
+				Action: RuleAction{Description: "Remote Work/Call", Tags: []string{"@Phone"}}},
+		},
+	}
+}
+
+// match returns the highest-priority rule whose When clause is satisfied by
+// signals, or nil if none match. A signal absent from signals is treated as
+// false, matching the zero value new signals start at.
+func (rs *RuleSet) match(signals map[string]bool) *Rule {
+	for i := range rs.Rules {
+		if rs.Rules[i].matches(signals) {
+			return &rs.Rules[i]
+		}
+	}
+	return nil
+}
+
+// signalNames returns the set of signal names referenced anywhere in the
+// rule set's When clauses. Callers use it to bound metrics labels to the
+// signals an operator has actually configured, rather than whatever name a
+// caller of /signal/{name} happens to send.
+func (rs *RuleSet) signalNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, r := range rs.Rules {
+		for signal := range r.When {
+			names[signal] = true
+		}
+	}
+	return names
+}
+
+func (r *Rule) matches(signals map[string]bool) bool {
+	for signal, want := range r.When {
+		if want == "*" {
+			continue
+		}
+		if signals[signal] != (want == "true") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package main
+
+import "testing"
+
+func TestDefaultRuleSetMatchesOriginalTruthTable(t *testing.T) {
+	rs := defaultRuleSet()
+
+	cases := []struct {
+		signals map[string]bool
+		wantTag string
+		stop    bool
+	}{
+		{signals: map[string]bool{"at_work": false, "on_laptop": false, "on_phone": false}, stop: true},
+		{signals: map[string]bool{"at_work": true, "on_laptop": false, "on_phone": false}, wantTag: "@Work"},
+		{signals: map[string]bool{"at_work": true, "on_laptop": true, "on_phone": false}, wantTag: "@PC"},
+		{signals: map[string]bool{"at_work": true, "on_laptop": true, "on_phone": true}, wantTag: "@Phone"},
+		{signals: map[string]bool{"at_work": false, "on_laptop": true, "on_phone": false}, wantTag: "@PC"},
+		{signals: map[string]bool{"at_work": false, "on_laptop": true, "on_phone": true}, wantTag: "@Phone"},
+		{signals: map[string]bool{"at_work": false, "on_laptop": false, "on_phone": true}, wantTag: "@Phone"},
+	}
+
+	for _, c := range cases {
+		rule := rs.match(c.signals)
+		if rule == nil {
+			t.Fatalf("match(%v) = nil, want a rule", c.signals)
+		}
+		if rule.Stop != c.stop {
+			t.Fatalf("match(%v).Stop = %v, want %v", c.signals, rule.Stop, c.stop)
+		}
+		if !c.stop && (len(rule.Action.Tags) != 1 || rule.Action.Tags[0] != c.wantTag) {
+			t.Fatalf("match(%v).Action.Tags = %v, want [%s]", c.signals, rule.Action.Tags, c.wantTag)
+		}
+	}
+}
+
+func TestRuleSetMatchPriorityOrder(t *testing.T) {
+	// match() returns the first Rules entry that matches, so callers (i.e.
+	// loadRuleSet, which this test bypasses) are expected to have already
+	// sorted Rules by descending priority.
+	rs := &RuleSet{
+		Rules: []Rule{
+			{Priority: 10, When: map[string]string{"on_phone": "true", "at_work": "true"}, Action: RuleAction{Description: "high priority"}},
+			{Priority: 1, When: map[string]string{"on_phone": "true"}, Action: RuleAction{Description: "low priority"}},
+		},
+	}
+
+	rule := rs.match(map[string]bool{"on_phone": true, "at_work": true})
+	if rule == nil || rule.Action.Description != "high priority" {
+		t.Fatalf("expected the higher-priority rule to win, got %+v", rule)
+	}
+}
+
+func TestRuleSetMatchWildcard(t *testing.T) {
+	rs := &RuleSet{
+		Rules: []Rule{
+			{When: map[string]string{"on_phone": "*", "at_work": "true"}, Action: RuleAction{Description: "at work, any phone state"}},
+		},
+	}
+
+	for _, phone := range []bool{true, false} {
+		rule := rs.match(map[string]bool{"on_phone": phone, "at_work": true})
+		if rule == nil {
+			t.Fatalf("expected wildcard rule to match with on_phone=%v", phone)
+		}
+	}
+
+	if rule := rs.match(map[string]bool{"on_phone": true, "at_work": false}); rule != nil {
+		t.Fatalf("expected no match when a non-wildcard signal disagrees, got %+v", rule)
+	}
+}
+
+func TestRuleSetMatchMissingSignalTreatedAsFalse(t *testing.T) {
+	rs := &RuleSet{
+		Rules: []Rule{
+			{When: map[string]string{"away": "false"}, Action: RuleAction{Description: "default"}},
+		},
+	}
+
+	rule := rs.match(map[string]bool{})
+	if rule == nil {
+		t.Fatal("expected a signal absent from the map to be treated as false")
+	}
+}
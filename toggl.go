@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// togglTimeEntryDto mirrors the subset of the Toggl Track v9 time entry
+// response this tool cares about.
+type togglTimeEntryDto struct {
+	Id int64
+}
+
+// togglTagDto mirrors a Toggl Track tag, which (unlike Clockify) uses
+// numeric ids.
+type togglTagDto struct {
+	Id   int64
+	Name string
+}
+
+// togglBackend reports time entries to Toggl Track (https://track.toggl.com)
+// via the v9 API, authenticating with an API token as HTTP Basic username.
+type togglBackend struct {
+	apiToken    string
+	workspaceID string
+	projectID   string
+	tags        map[string]string
+}
+
+func newTogglBackend(apiToken, workspaceID, projectID string) *togglBackend {
+	b := &togglBackend{apiToken: apiToken, workspaceID: workspaceID, projectID: projectID}
+
+	tags, err := b.ListTags(context.Background())
+	if err != nil {
+		logger.Warn("toggl: failed to list tags", "error", err)
+	}
+	b.tags = tags
+
+	return b
+}
+
+func (b *togglBackend) authHeader() string {
+	return basicAuthHeader(b.apiToken, "api_token")
+}
+
+// numericOrNull renders id as a bare JSON numeric literal, or "null" when
+// unset. Toggl's v9 API rejects project_id/workspace_id sent as strings, so
+// unlike Clockify's ids these can never be quoted.
+func numericOrNull(id string) string {
+	if id == "" {
+		return "null"
+	}
+	return id
+}
+
+func (b *togglBackend) StartEntry(ctx context.Context, desc string, tags []string, opts StartEntryOptions) (EntryID, error) {
+	tagString := ""
+	for _, tag := range tags {
+		if _, ok := b.tags[tag]; !ok {
+			continue
+		}
+		if tagString != "" {
+			tagString += ","
+		}
+		tagString += `"` + tag + `"`
+	}
+
+	projectID := b.projectID
+	if opts.ProjectID != "" {
+		projectID = opts.ProjectID
+	}
+	billable := true
+	if opts.Billable != nil {
+		billable = *opts.Billable
+	}
+
+	var jsonStr = `{
+		"billable": ` + strconv.FormatBool(billable) + `,
+		"created_with": "auto-timetracker",
+		"description": "` + desc + `",
+		"project_id": ` + numericOrNull(projectID) + `,
+		"start": "` + time.Now().UTC().Format("2006-01-02T15:04:05.000Z") + `",
+		"tags": [` + tagString + `],
+		"workspace_id": ` + numericOrNull(b.workspaceID) + `,
+		"duration": -1
+	  }`
+
+	var response togglTimeEntryDto
+	if err := requestWithHeader(ctx, "POST", "https://api.track.toggl.com/api/v9/workspaces/"+b.workspaceID+"/time_entries", &response, jsonStr, "Authorization", b.authHeader()); err != nil {
+		return "", err
+	}
+
+	return EntryID(strconv.FormatInt(response.Id, 10)), nil
+}
+
+func (b *togglBackend) StopEntry(ctx context.Context, id EntryID) error {
+	var body interface{}
+	return requestWithHeader(ctx, "PATCH", "https://api.track.toggl.com/api/v9/workspaces/"+b.workspaceID+"/time_entries/"+string(id)+"/stop", &body, "", "Authorization", b.authHeader())
+}
+
+func (b *togglBackend) ListTags(ctx context.Context) (map[string]string, error) {
+	var tags []togglTagDto
+	if err := requestWithHeader(ctx, "GET", "https://api.track.toggl.com/api/v9/workspaces/"+b.workspaceID+"/tags", &tags, "", "Authorization", b.authHeader()); err != nil {
+		return nil, err
+	}
+
+	tagMap := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		tagMap[tag.Name] = strconv.FormatInt(tag.Id, 10)
+	}
+	return tagMap, nil
+}